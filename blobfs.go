@@ -5,10 +5,15 @@
 package blobfs
 
 import (
+	"bytes"
 	"context"
+	"crypto/md5"
 	"errors"
+	"hash"
 	"io"
 	"io/fs"
+	"path"
+	"sort"
 	"strings"
 	"time"
 
@@ -23,17 +28,173 @@ const (
 
 // An FS is a read-only blob storage file system that implements fs.FS interface.
 type FS struct {
-	bucket *blob.Bucket
+	bucket         *blob.Bucket
+	callback       IOFSCallback
+	prefix         string
+	spillThreshold int64
+	verifyMD5      bool
+
+	cache            Cache
+	cacheTTL         time.Duration
+	negativeCacheTTL time.Duration
 }
 
 var (
 	_ fs.ReadFileFS = (*FS)(nil)
 	_ fs.ReadDirFS  = (*FS)(nil)
+	_ fs.SubFS      = (*FS)(nil)
+	_ fs.StatFS     = (*FS)(nil)
+	_ fs.GlobFS     = (*FS)(nil)
 )
 
+// IOFSCallback returns the context.Context and *blob.ReaderOptions to use
+// for a single fs operation. It is called afresh for every operation
+// rather than cached: once by Open, ReadDir, and Stat, once by each ReadAt
+// on an already-open file, and twice by ReadFile (once to open, once to
+// read), so implementations can return a fresh context per call, e.g. one
+// derived from an in-flight *http.Request. The exception is openFile's
+// streaming Read: it only consults the callback when it opens a new
+// RangeReader (once per contiguous run of sequential Read calls), reusing
+// that context until a Seek displaces the reader or the reader reaches the
+// end of the file, so a context rotated mid-stream won't be picked up
+// until then.
+type IOFSCallback func() (context.Context, *blob.ReaderOptions)
+
+// Option configures an FS constructed with New.
+type Option func(*FS)
+
+// WithIOFSCallback sets the callback used to obtain a context.Context and
+// *blob.ReaderOptions for every fs operation. See SetIOFSCallback.
+func WithIOFSCallback(cb IOFSCallback) Option {
+	return func(fsys *FS) { fsys.callback = cb }
+}
+
+// defaultSpillThreshold is the amount of data a WritableFile buffers in
+// memory before moving its content to a temporary file.
+const defaultSpillThreshold = 16 << 20 // 16 MiB
+
+// WithWriteSpillThreshold sets the number of bytes a WritableFile created
+// through a RWFS buffers in memory before spilling to a temporary file on
+// disk. It has no effect on a read-only FS. The default is 16 MiB.
+func WithWriteSpillThreshold(n int64) Option {
+	return func(fsys *FS) { fsys.spillThreshold = n }
+}
+
+// WithVerifyMD5 makes ReadFile, Read, and any ReadAt spanning a whole
+// object verify the bytes they return against the MD5 digest the backend
+// reported for that object, returning a *ChecksumError if they disagree.
+// Objects the backend reported no MD5 for, ReadAt calls that only cover
+// part of an object, and Read calls after a Seek has moved off the
+// sequential run that began at offset 0 are not checked.
+func WithVerifyMD5() Option {
+	return func(fsys *FS) { fsys.verifyMD5 = true }
+}
+
+// WithCache makes lookup (used by Open, ReadFile, ReadDir, and Stat)
+// consult cache before calling bucket.Attributes/List, and populate it
+// afterwards -- including negative entries for names that don't exist,
+// so repeatedly looking up a missing name doesn't keep round-tripping to
+// the bucket. ReadDir also populates cache with every entry it lists, so
+// a following lookup of one of those files makes no bucket call; a listed
+// subdirectory still costs one Attributes call. Positive entries are
+// cached for ttl; see WithNegativeCacheTTL for the negative entries' TTL.
+func WithCache(cache Cache, ttl time.Duration) Option {
+	return func(fsys *FS) {
+		fsys.cache = cache
+		fsys.cacheTTL = ttl
+	}
+}
+
+// defaultNegativeCacheTTLDivisor is how much shorter than the positive
+// TTL the default negative TTL is, to bound how long an eventual-
+// consistency race can poison the cache with a stale "not found".
+const defaultNegativeCacheTTLDivisor = 4
+
+// WithNegativeCacheTTL overrides the TTL WithCache uses for negative
+// entries. It defaults to the positive TTL divided by
+// defaultNegativeCacheTTLDivisor.
+func WithNegativeCacheTTL(ttl time.Duration) Option {
+	return func(fsys *FS) { fsys.negativeCacheTTL = ttl }
+}
+
 // New returns FS object that can interact with a blob storage.
-func New(bucket *blob.Bucket) *FS {
-	return &FS{bucket: bucket}
+func New(bucket *blob.Bucket, opts ...Option) *FS {
+	fsys := &FS{bucket: bucket}
+	for _, opt := range opts {
+		opt(fsys)
+	}
+	return fsys
+}
+
+// SetIOFSCallback sets cb to be consulted for each fs operation to obtain
+// the context.Context and *blob.ReaderOptions passed to the underlying
+// blob.Bucket calls made by Open, ReadFile, ReadDir, and Read/ReadAt on any
+// file opened through fsys. This lets callers propagate cancellation,
+// deadlines, tracing, or options such as ReaderOptions.BeforeRead from,
+// for example, an net/http handler down to gocloud. When cb is nil, fsys
+// falls back to context.TODO() and nil options, as if SetIOFSCallback had
+// never been called.
+func (fsys *FS) SetIOFSCallback(cb IOFSCallback) {
+	fsys.callback = cb
+}
+
+func (fsys *FS) ioFSArgs() (context.Context, *blob.ReaderOptions) {
+	if fsys.callback == nil {
+		return context.TODO(), nil
+	}
+	return fsys.callback()
+}
+
+func (fsys *FS) writeSpillThreshold() int64 {
+	if fsys.spillThreshold > 0 {
+		return fsys.spillThreshold
+	}
+	return defaultSpillThreshold
+}
+
+func (fsys *FS) negativeTTL() time.Duration {
+	if fsys.negativeCacheTTL > 0 {
+		return fsys.negativeCacheTTL
+	}
+	return fsys.cacheTTL / defaultNegativeCacheTTLDivisor
+}
+
+// cacheLookup returns the CacheEntry cached for key, translated into the
+// (*fileListEntry, error) pair lookup would have returned, and whether it
+// was cached at all (a cache miss reports ok == false, regardless of
+// whether the entry turns out to be found or not).
+func (fsys *FS) cacheLookup(key string) (e *fileListEntry, ok bool, err error) {
+	if fsys.cache == nil {
+		return nil, false, nil
+	}
+	ce, ok := fsys.cache.Get(key)
+	if !ok {
+		return nil, false, nil
+	}
+	if !ce.Found {
+		return nil, true, fs.ErrNotExist
+	}
+	return &fileListEntry{obj: ce.Object}, true, nil
+}
+
+func (fsys *FS) cachePutFound(key string, obj *blob.ListObject) {
+	if fsys.cache == nil {
+		return
+	}
+	fsys.cache.Put(key, CacheEntry{Found: true, Object: obj}, fsys.cacheTTL)
+}
+
+func (fsys *FS) cachePutNotFound(key string) {
+	if fsys.cache == nil {
+		return
+	}
+	fsys.cache.Put(key, CacheEntry{Found: false}, fsys.negativeTTL())
+}
+
+func (fsys *FS) invalidateCache(key string) {
+	if fsys.cache != nil {
+		fsys.cache.Invalidate(key)
+	}
 }
 
 var rootFile = &fileListEntry{
@@ -72,34 +233,207 @@ func (fsys *FS) lookup(ctx context.Context, name string) (*fileListEntry, error)
 	if name == "." {
 		return rootFile, nil
 	}
-	attr, err := fsys.bucket.Attributes(ctx, name)
+	key := fsys.fullKey(name)
+	dirKey := key + "/"
+
+	if e, ok, err := fsys.cacheLookup(key); ok {
+		return e, err
+	}
+	attr, err := fsys.bucket.Attributes(ctx, key)
 	if err == nil {
-		return &fileListEntry{obj: &blob.ListObject{
-			Key:     name,
+		obj := &blob.ListObject{
+			Key:     key,
 			ModTime: attr.ModTime,
 			Size:    attr.Size,
 			MD5:     attr.MD5,
 			IsDir:   false,
-		}}, err
+		}
+		fsys.cachePutFound(key, obj)
+		return &fileListEntry{obj: obj}, nil
+	}
+
+	if e, ok, err := fsys.cacheLookup(dirKey); ok {
+		return e, err
+	}
+	e, err := fsys.searchDir(ctx, key)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			fsys.cachePutNotFound(key)
+			fsys.cachePutNotFound(dirKey)
+		}
+		return nil, err
+	}
+	fsys.cachePutFound(dirKey, e.obj)
+	return e, nil
+}
+
+// fullKey maps name, which is relative to fsys (as seen through Sub), to
+// the key used to talk to the underlying bucket.
+func (fsys *FS) fullKey(name string) string {
+	if name == "" || name == "." {
+		return fsys.prefix
+	}
+	if fsys.prefix == "" {
+		return name
+	}
+	return fsys.prefix + "/" + name
+}
+
+// Sub implements fs.SubFS. The returned FS shares the same bucket,
+// IOFSCallback, and other options as fsys, but every operation on it is
+// relative to dir: dir is prepended to the key before each bucket call.
+func (fsys *FS) Sub(dir string) (fs.FS, error) {
+	if !fs.ValidPath(dir) {
+		return nil, &fs.PathError{Op: "sub", Path: dir, Err: fs.ErrInvalid}
+	}
+	if dir == "." {
+		return fsys, nil
+	}
+	sub := *fsys
+	sub.prefix = fsys.fullKey(dir)
+	return &sub, nil
+}
+
+// Stat implements fs.StatFS. It returns file info for name without opening
+// a reader on it.
+func (fsys *FS) Stat(name string) (fs.FileInfo, error) {
+	ctx, _ := fsys.ioFSArgs()
+	e, err := fsys.lookup(ctx, name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+	return e, nil
+}
+
+func hasMeta(s string) bool {
+	return strings.ContainsAny(s, `*?[\`)
+}
+
+// Glob implements fs.GlobFS. Unlike the generic fs.Glob fallback, it never
+// scans the whole bucket: the pattern's leading literal path components
+// (those with no *?[\ metacharacters) bound every List call, so
+// Glob("images/*.png") only lists the "images/" prefix.
+func (fsys *FS) Glob(pattern string) ([]string, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+	if pattern == "." {
+		return []string{"."}, nil
+	}
+	ctx, _ := fsys.ioFSArgs()
+	var matches []string
+	if err := fsys.glob(ctx, fsys.prefix, "", strings.Split(pattern, "/"), &matches); err != nil {
+		return nil, err
+	}
+	sort.Strings(matches)
+	return matches, nil
+}
+
+// glob matches comps, the remaining "/"-separated pattern components,
+// against entries below dirKey (the real bucket key of the directory
+// currently being searched, already including fsys.prefix) and appends
+// matches to *matches using dirName (the fsys-relative name of that same
+// directory) as the base for constructed names.
+func (fsys *FS) glob(ctx context.Context, dirKey, dirName string, comps []string, matches *[]string) error {
+	comp := comps[0]
+	rest := comps[1:]
+
+	if !hasMeta(comp) {
+		childKey := comp
+		if dirKey != "" {
+			childKey = dirKey + "/" + comp
+		}
+		childName := comp
+		if dirName != "" {
+			childName = dirName + "/" + comp
+		}
+		if len(rest) == 0 {
+			if _, err := fsys.bucket.Attributes(ctx, childKey); err == nil {
+				*matches = append(*matches, childName)
+				return nil
+			}
+			if _, err := fsys.searchDir(ctx, childKey); err == nil {
+				*matches = append(*matches, childName)
+			}
+			return nil
+		}
+		if _, err := fsys.searchDir(ctx, childKey); err == nil {
+			return fsys.glob(ctx, childKey, childName, rest, matches)
+		}
+		return nil
+	}
+
+	listPrefix := dirKey
+	if listPrefix != "" {
+		listPrefix += "/"
+	}
+	iter := fsys.bucket.List(&blob.ListOptions{Delimiter: "/", Prefix: listPrefix})
+	for {
+		obj, err := iter.Next(ctx)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if obj.Key == listPrefix {
+			// The directory's own zero-byte placeholder object (see
+			// RWFS.Mkdir), not one of its children.
+			continue
+		}
+		base := strings.TrimSuffix(obj.Key, "/")
+		if i := strings.LastIndex(base, "/"); i >= 0 {
+			base = base[i+1:]
+		}
+		ok, err := path.Match(comp, base)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		childName := base
+		if dirName != "" {
+			childName = dirName + "/" + base
+		}
+		if len(rest) == 0 {
+			*matches = append(*matches, childName)
+			continue
+		}
+		if obj.IsDir {
+			if err := fsys.glob(ctx, strings.TrimSuffix(obj.Key, "/"), childName, rest, matches); err != nil {
+				return err
+			}
+		}
 	}
-	return fsys.searchDir(ctx, name)
+	return nil
 }
 
 // Open opens the named file for reading and returns it as an fs.File.
 func (fsys *FS) Open(name string) (fs.File, error) {
-	ctx := context.TODO()
+	ctx, _ := fsys.ioFSArgs()
 	e, err := fsys.lookup(ctx, name)
 	if err != nil {
 		return nil, &fs.PathError{Op: opOpen, Path: name, Err: err}
 	}
 	if e.IsDir() {
-		dir, err := newOpenDir(ctx, e, fsys.bucket)
+		prefix := e.Path()
+		if name == "." {
+			// e is the shared rootFile sentinel, whose Path is always ""
+			// regardless of fsys.prefix, so the real listing prefix for the
+			// root of a Sub'd FS has to be derived separately.
+			prefix = fsys.prefix
+			if prefix != "" {
+				prefix += "/"
+			}
+		}
+		dir, err := newOpenDir(ctx, fsys, e, prefix)
 		if err != nil {
 			return nil, &fs.PathError{Op: opOpen, Path: name, Err: err}
 		}
 		return dir, nil
 	}
-	file, err := newOpenFile(e, fsys.bucket)
+	file, err := newOpenFile(e, fsys.bucket, fsys.callback, fsys.verifyMD5)
 	if err != nil {
 		return nil, &fs.PathError{Op: opOpen, Path: name, Err: err}
 	}
@@ -176,9 +510,26 @@ func (e *fileListEntry) Mode() fs.FileMode {
 func (e *fileListEntry) Path() string { return e.obj.Key }
 
 type openFile struct {
-	self   *fileListEntry
-	bucket *blob.Bucket
-	offset int64
+	self      *fileListEntry
+	bucket    *blob.Bucket
+	offset    int64
+	callback  IOFSCallback
+	verifyMD5 bool
+
+	// reader is a long-lived, read-to-end *blob.Reader positioned at
+	// readerPos, reused across Read calls so that sequential consumption
+	// (io.Copy, io.ReadAll, template rendering, ...) issues a single
+	// NewRangeReader round-trip instead of one per Read buffer. ReadAt
+	// never touches it; Seek discards it only when it moves f.offset away
+	// from readerPos, and the next Read then opens a fresh one.
+	reader    *blob.Reader
+	readerPos int64
+
+	// hasher, when non-nil, has digested every byte Read has returned
+	// since offset 0. It is only kept alive across a contiguous run from
+	// the start of the file, so it can be compared against self.obj.MD5
+	// once Read reaches EOF.
+	hasher hash.Hash
 }
 
 var (
@@ -187,16 +538,33 @@ var (
 	_ io.Seeker   = (*openFile)(nil)
 )
 
-func newOpenFile(entry *fileListEntry, bucket *blob.Bucket) (*openFile, error) {
+func newOpenFile(entry *fileListEntry, bucket *blob.Bucket, cb IOFSCallback, verifyMD5 bool) (*openFile, error) {
 	return &openFile{
-		self:   entry,
-		bucket: bucket,
-		offset: 0,
+		self:      entry,
+		bucket:    bucket,
+		offset:    0,
+		callback:  cb,
+		verifyMD5: verifyMD5,
 	}, nil
 }
 
+func (f *openFile) ioFSArgs() (context.Context, *blob.ReaderOptions) {
+	if f.callback == nil {
+		return context.TODO(), nil
+	}
+	return f.callback()
+}
+
 func (f *openFile) Stat() (fs.FileInfo, error) { return f.self, nil }
-func (f *openFile) Close() error               { return nil }
+
+func (f *openFile) Close() error {
+	if f.reader == nil {
+		return nil
+	}
+	err := f.reader.Close()
+	f.reader = nil
+	return err
+}
 
 func (f *openFile) Read(b []byte) (int, error) {
 	if len(b) == 0 {
@@ -206,17 +574,48 @@ func (f *openFile) Read(b []byte) (int, error) {
 		return 0, io.EOF
 	}
 
-	ctx := context.TODO()
-	r, err := f.bucket.NewRangeReader(ctx, f.self.Path(), f.offset, int64(len(b)), nil)
-	if err != nil {
-		return 0, &fs.PathError{Op: opRead, Path: f.self.Path(), Err: err}
+	if f.reader != nil && f.readerPos != f.offset {
+		f.reader.Close()
+		f.reader = nil
+		// The stream was interrupted by a Seek, so whatever the
+		// hasher has seen no longer covers the whole file from the start.
+		f.hasher = nil
+	}
+	if f.reader == nil {
+		ctx, ropts := f.ioFSArgs()
+		r, err := f.bucket.NewRangeReader(ctx, f.self.Path(), f.offset, -1, ropts)
+		if err != nil {
+			return 0, &fs.PathError{Op: opRead, Path: f.self.Path(), Err: err}
+		}
+		f.reader = r
+		f.readerPos = f.offset
+		if f.verifyMD5 && f.offset == 0 && len(f.self.obj.MD5) > 0 {
+			f.hasher = md5.New()
+		}
+	}
+
+	size, err := f.reader.Read(b)
+	if f.hasher != nil && size > 0 {
+		f.hasher.Write(b[:size])
 	}
-	size, err := r.Read(b)
 	f.offset += int64(size)
-	if err != nil {
-		return size, err
+	f.readerPos += int64(size)
+	// Some drivers (fileblob, memblob included) return the final chunk
+	// with err == nil and only signal io.EOF on a subsequent call, so the
+	// hasher must be finalized as soon as offset reaches the end of the
+	// object, not only when the driver's Read itself reports io.EOF.
+	if f.offset >= f.self.Size() {
+		f.reader.Close()
+		f.reader = nil
+		if f.hasher != nil {
+			sum := f.hasher.Sum(nil)
+			f.hasher = nil
+			if !bytes.Equal(sum, f.self.obj.MD5) {
+				return size, newChecksumError(opRead, f.self.Path(), sum, f.self.obj.MD5)
+			}
+		}
 	}
-	return size, r.Close()
+	return size, err
 }
 
 func (f *openFile) ReadAt(b []byte, offset int64) (int, error) {
@@ -227,13 +626,29 @@ func (f *openFile) ReadAt(b []byte, offset int64) (int, error) {
 		return 0, io.EOF
 	}
 
-	ctx := context.TODO()
-	r, err := f.bucket.NewRangeReader(ctx, f.self.Path(), offset, int64(len(b)), nil)
+	ctx, ropts := f.ioFSArgs()
+	r, err := f.bucket.NewRangeReader(ctx, f.self.Path(), offset, int64(len(b)), ropts)
 	if err != nil {
 		return 0, &fs.PathError{Op: opRead, Path: f.self.Path(), Err: err}
 	}
+	// Only a ReadAt spanning the whole object, starting at 0, can be
+	// checked against the stored MD5; a partial range can't be.
+	verifyFull := f.verifyMD5 && offset == 0 && int64(len(b)) == f.self.Size() && len(f.self.obj.MD5) > 0
+	var h hash.Hash
+	if verifyFull {
+		h = md5.New()
+	}
 	size, err := r.Read(b)
+	if h != nil && size > 0 {
+		h.Write(b[:size])
+	}
 	if offset+int64(size) == f.self.Size() {
+		if h != nil {
+			if sum := h.Sum(nil); !bytes.Equal(sum, f.self.obj.MD5) {
+				r.Close()
+				return size, newChecksumError(opRead, f.self.Path(), sum, f.self.obj.MD5)
+			}
+		}
 		return size, io.EOF
 	}
 	if err != nil {
@@ -256,6 +671,13 @@ func (f *openFile) Seek(offset int64, whence int) (int64, error) {
 	if offset < 0 || offset > f.self.Size() {
 		return 0, &fs.PathError{Op: opSeek, Path: f.self.Path(), Err: fs.ErrInvalid}
 	}
+	if f.reader != nil && offset != f.readerPos {
+		f.reader.Close()
+		f.reader = nil
+		// The seek discards whatever the hasher has accumulated so far,
+		// so it no longer covers a contiguous range from the start.
+		f.hasher = nil
+	}
 	f.offset = offset
 	return offset, nil
 }
@@ -270,10 +692,10 @@ var (
 	_ fs.ReadDirFile = (*openDir)(nil)
 )
 
-func newOpenDir(ctx context.Context, entry *fileListEntry, bucket *blob.Bucket) (*openDir, error) {
-	iter := bucket.List(&blob.ListOptions{
+func newOpenDir(ctx context.Context, fsys *FS, entry *fileListEntry, prefix string) (*openDir, error) {
+	iter := fsys.bucket.List(&blob.ListOptions{
 		Delimiter: "/",
-		Prefix:    entry.Path(),
+		Prefix:    prefix,
 	})
 	files := make([]*fileListEntry, 0)
 	for {
@@ -284,7 +706,16 @@ func newOpenDir(ctx context.Context, entry *fileListEntry, bucket *blob.Bucket)
 		if err != nil {
 			return nil, err
 		}
+		if obj.Key == prefix {
+			// The directory's own zero-byte placeholder object (see
+			// RWFS.Mkdir), not one of its children.
+			continue
+		}
 		files = append(files, &fileListEntry{obj: obj})
+		// Prime the cache with every child a directory listing already
+		// paid to fetch, so Open(dir/child) of a file right after a
+		// ReadDir(dir) makes no lookup call to the bucket.
+		fsys.cachePutFound(obj.Key, obj)
 	}
 	return &openDir{self: entry, entries: files}, nil
 }
@@ -2,13 +2,17 @@ package blobfs_test
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
+	"reflect"
 	"testing"
 	"testing/fstest"
 
 	"gocloud.dev/blob"
 	_ "gocloud.dev/blob/fileblob"
+	_ "gocloud.dev/blob/memblob"
 
 	"github.com/ichizero/blobfs"
 )
@@ -40,3 +44,172 @@ func TestFS(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestFS_Sub(t *testing.T) {
+	ctx := context.Background()
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bucket, err := blob.OpenBucket(ctx, fmt.Sprintf("file://%s/testdata", dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fsys := blobfs.New(bucket)
+	sub, err := fs.Sub(fsys, "dir1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fstest.TestFS(sub, "hoge.txt", "dir1-1", "dir1-1/fuga.txt"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFS_Stat(t *testing.T) {
+	ctx := context.Background()
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bucket, err := blob.OpenBucket(ctx, fmt.Sprintf("file://%s/testdata", dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fsys := blobfs.New(bucket)
+	info, err := fs.Stat(fsys, "foo.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Name() != "foo.txt" {
+		t.Fatalf("unexpected name: %s", info.Name())
+	}
+	if info.IsDir() {
+		t.Fatal("foo.txt should not be a directory")
+	}
+}
+
+func TestFS_Glob(t *testing.T) {
+	ctx := context.Background()
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bucket, err := blob.OpenBucket(ctx, fmt.Sprintf("file://%s/testdata", dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fsys := blobfs.New(bucket)
+	matches, err := fs.Glob(fsys, "*.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"bar.txt", "foo.txt"}
+	if !reflect.DeepEqual(matches, want) {
+		t.Fatalf("got %v, want %v", matches, want)
+	}
+
+	matches, err = fs.Glob(fsys, "dir1/*/fuga.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []string{"dir1/dir1-1/fuga.txt"}
+	if !reflect.DeepEqual(matches, want) {
+		t.Fatalf("got %v, want %v", matches, want)
+	}
+}
+
+// TestFS_IOFSCallback checks that WithIOFSCallback's callback is actually
+// consulted by fs operations, rather than only by the zero-value
+// context.TODO()/nil fallback.
+func TestFS_IOFSCallback(t *testing.T) {
+	ctx := context.Background()
+	memBucket, err := blob.OpenBucket(ctx, "mem://")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := memBucket.WriteAll(ctx, "foo.txt", []byte("hello"), nil); err != nil {
+		t.Fatal(err)
+	}
+	bucket, _ := newCountingBucket(memBucket)
+
+	var calls int
+	fsys := blobfs.New(bucket, blobfs.WithIOFSCallback(func() (context.Context, *blob.ReaderOptions) {
+		calls++
+		return ctx, nil
+	}))
+
+	if _, err := fsys.Stat("foo.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if calls == 0 {
+		t.Fatal("IOFSCallback was never invoked by Stat")
+	}
+
+	before := calls
+	if _, err := fsys.ReadFile("foo.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if calls <= before {
+		t.Fatal("IOFSCallback was not invoked by ReadFile")
+	}
+}
+
+// TestFS_IOFSCallback_CancelAbortsRead checks that a context.Context
+// returned by the callback actually governs the bucket call it's passed
+// to: once openFile.Read needs to open a new RangeReader, a canceled
+// context returned for that call aborts the read.
+func TestFS_IOFSCallback_CancelAbortsRead(t *testing.T) {
+	ctx := context.Background()
+	memBucket, err := blob.OpenBucket(ctx, "mem://")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := memBucket.WriteAll(ctx, "foo.txt", []byte("hello"), nil); err != nil {
+		t.Fatal(err)
+	}
+	bucket, _ := newCountingBucket(memBucket)
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+
+	var calls int
+	fsys := blobfs.New(bucket, blobfs.WithIOFSCallback(func() (context.Context, *blob.ReaderOptions) {
+		calls++
+		if calls == 1 {
+			return ctx, nil // used by Open's lookup
+		}
+		return canceled, nil // used by Read's first RangeReader open
+	}))
+
+	f, err := fsys.Open("foo.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if _, err := f.Read(make([]byte, 4)); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Read() error = %v, want context.Canceled", err)
+	}
+}
+
+// TestFS_IOFSCallback_NilFallback checks that an FS with no
+// WithIOFSCallback still works, falling back to context.TODO() and nil
+// ReaderOptions as documented.
+func TestFS_IOFSCallback_NilFallback(t *testing.T) {
+	ctx := context.Background()
+	bucket, err := blob.OpenBucket(ctx, "mem://")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bucket.WriteAll(ctx, "foo.txt", []byte("hello"), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	fsys := blobfs.New(bucket)
+	if _, err := fsys.Stat("foo.txt"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,111 @@
+package blobfs
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"gocloud.dev/blob"
+)
+
+// A Cache memoises what lookup would otherwise fetch from the bucket via
+// Attributes/List, including negative entries for keys that don't exist.
+// See WithCache.
+type Cache interface {
+	// Get returns the entry cached for key and whether one was found.
+	Get(key string) (CacheEntry, bool)
+	// Put caches entry for key until ttl elapses.
+	Put(key string, entry CacheEntry, ttl time.Duration)
+	// Invalidate removes any entry cached for key.
+	Invalidate(key string)
+}
+
+// A CacheEntry is what a Cache stores for a key. Found reports whether
+// the key exists in the bucket; when it does, Object is the metadata
+// lookup would otherwise have fetched. A CacheEntry with Found == false
+// is a negative entry: it records that the key is known not to exist.
+type CacheEntry struct {
+	Found  bool
+	Object *blob.ListObject
+}
+
+// An LRUCache is an in-memory Cache holding at most capacity entries; see
+// NewLRUCache. The zero value is not usable; construct one with
+// NewLRUCache. It is safe for concurrent use.
+type LRUCache struct {
+	capacity int
+
+	mu    sync.Mutex
+	ll    *list.List
+	items map[string]*list.Element
+}
+
+var _ Cache = (*LRUCache)(nil)
+
+type lruCacheItem struct {
+	key     string
+	entry   CacheEntry
+	expires time.Time
+}
+
+// NewLRUCache returns an LRUCache that holds at most capacity entries,
+// evicting the least recently used one once full. capacity <= 0 means
+// unlimited: no entry is ever evicted for being least recently used, only
+// for expiring (see Put's ttl).
+func NewLRUCache(capacity int) *LRUCache {
+	return &LRUCache{
+		capacity: capacity,
+		ll:       list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+func (c *LRUCache) Get(key string) (CacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[key]
+	if !ok {
+		return CacheEntry{}, false
+	}
+	item := el.Value.(*lruCacheItem)
+	if time.Now().After(item.expires) {
+		c.removeElement(el)
+		return CacheEntry{}, false
+	}
+	c.ll.MoveToFront(el)
+	return item.entry, true
+}
+
+func (c *LRUCache) Put(key string, entry CacheEntry, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		item := el.Value.(*lruCacheItem)
+		item.entry = entry
+		item.expires = time.Now().Add(ttl)
+		c.ll.MoveToFront(el)
+		return
+	}
+
+	el := c.ll.PushFront(&lruCacheItem{key: key, entry: entry, expires: time.Now().Add(ttl)})
+	c.items[key] = el
+	if c.capacity > 0 && c.ll.Len() > c.capacity {
+		c.removeElement(c.ll.Back())
+	}
+}
+
+func (c *LRUCache) Invalidate(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		c.removeElement(el)
+	}
+}
+
+func (c *LRUCache) removeElement(el *list.Element) {
+	c.ll.Remove(el)
+	delete(c.items, el.Value.(*lruCacheItem).key)
+}
@@ -0,0 +1,176 @@
+package blobfs_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"gocloud.dev/blob"
+	"gocloud.dev/blob/driver"
+	_ "gocloud.dev/blob/memblob"
+	"gocloud.dev/gcerrors"
+
+	"github.com/ichizero/blobfs"
+)
+
+// countingBucket wraps a *blob.Bucket and counts how many times its
+// Attributes and ListPaged methods are invoked, so tests can assert that a
+// Cache actually suppresses redundant round-trips to the bucket.
+type countingBucket struct {
+	inner           *blob.Bucket
+	attributesCalls int
+	listPagedCalls  int
+}
+
+func newCountingBucket(inner *blob.Bucket) (*blob.Bucket, *countingBucket) {
+	cb := &countingBucket{inner: inner}
+	return blob.NewBucket(cb), cb
+}
+
+func (b *countingBucket) Attributes(ctx context.Context, key string) (*driver.Attributes, error) {
+	b.attributesCalls++
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	attr, err := b.inner.Attributes(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return &driver.Attributes{
+		ContentType: attr.ContentType,
+		Metadata:    attr.Metadata,
+		ModTime:     attr.ModTime,
+		Size:        attr.Size,
+		MD5:         attr.MD5,
+		ETag:        attr.ETag,
+	}, nil
+}
+
+func (b *countingBucket) ListPaged(ctx context.Context, opts *driver.ListOptions) (*driver.ListPage, error) {
+	b.listPagedCalls++
+	iter := b.inner.List(&blob.ListOptions{Prefix: opts.Prefix, Delimiter: opts.Delimiter})
+	var objs []*driver.ListObject
+	for {
+		obj, err := iter.Next(ctx)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		objs = append(objs, &driver.ListObject{
+			Key:     obj.Key,
+			ModTime: obj.ModTime,
+			Size:    obj.Size,
+			MD5:     obj.MD5,
+			IsDir:   obj.IsDir,
+		})
+	}
+	return &driver.ListPage{Objects: objs}, nil
+}
+
+func (b *countingBucket) NewRangeReader(ctx context.Context, key string, offset, length int64, opts *driver.ReaderOptions) (driver.Reader, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r, err := b.inner.NewRangeReader(ctx, key, offset, length, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &countingBucketReader{r}, nil
+}
+
+func (b *countingBucket) NewTypedWriter(ctx context.Context, key, contentType string, opts *driver.WriterOptions) (driver.Writer, error) {
+	return b.inner.NewWriter(ctx, key, nil)
+}
+
+func (b *countingBucket) Copy(ctx context.Context, dstKey, srcKey string, opts *driver.CopyOptions) error {
+	return b.inner.Copy(ctx, dstKey, srcKey, nil)
+}
+
+func (b *countingBucket) Delete(ctx context.Context, key string) error {
+	return b.inner.Delete(ctx, key)
+}
+
+func (b *countingBucket) SignedURL(ctx context.Context, key string, opts *driver.SignedURLOptions) (string, error) {
+	return "", errNotImplemented{}
+}
+
+func (b *countingBucket) Close() error                           { return nil }
+func (b *countingBucket) As(i interface{}) bool                  { return false }
+func (b *countingBucket) ErrorAs(error, interface{}) bool        { return false }
+func (b *countingBucket) ErrorCode(err error) gcerrors.ErrorCode { return gcerrors.Unknown }
+
+type errNotImplemented struct{}
+
+func (errNotImplemented) Error() string { return "not implemented" }
+
+// countingBucketReader adapts a *blob.Reader to driver.Reader.
+type countingBucketReader struct {
+	*blob.Reader
+}
+
+func (r *countingBucketReader) Attributes() *driver.ReaderAttributes {
+	return &driver.ReaderAttributes{
+		ContentType: r.ContentType(),
+		ModTime:     r.ModTime(),
+		Size:        r.Size(),
+	}
+}
+
+func (r *countingBucketReader) As(i interface{}) bool { return false }
+
+func TestFS_WithCache(t *testing.T) {
+	ctx := context.Background()
+	memBucket, err := blob.OpenBucket(ctx, "mem://")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := memBucket.NewWriter(ctx, "foo.txt", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	bucket, cb := newCountingBucket(memBucket)
+	fsys := blobfs.New(bucket, blobfs.WithCache(blobfs.NewLRUCache(64), time.Minute))
+
+	for i := 0; i < 5; i++ {
+		if _, err := fsys.Stat("foo.txt"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if cb.attributesCalls != 1 {
+		t.Errorf("attributesCalls = %d, want 1", cb.attributesCalls)
+	}
+
+	for i := 0; i < 5; i++ {
+		if _, err := fsys.Stat("missing.txt"); err == nil {
+			t.Fatal("Stat(missing.txt) succeeded unexpectedly")
+		}
+	}
+	if cb.attributesCalls != 2 {
+		t.Errorf("attributesCalls after repeated miss lookups = %d, want 2", cb.attributesCalls)
+	}
+}
+
+// TestLRUCache_UnlimitedCapacity checks that a non-positive capacity means
+// unlimited, as NewLRUCache documents, rather than evicting everything.
+func TestLRUCache_UnlimitedCapacity(t *testing.T) {
+	c := blobfs.NewLRUCache(0)
+	for i := 0; i < 1000; i++ {
+		c.Put(fmt.Sprintf("key%d", i), blobfs.CacheEntry{Found: true}, time.Minute)
+	}
+	for i := 0; i < 1000; i++ {
+		if _, ok := c.Get(fmt.Sprintf("key%d", i)); !ok {
+			t.Fatalf("key%d evicted from an unlimited-capacity cache", i)
+		}
+	}
+}
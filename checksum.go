@@ -0,0 +1,47 @@
+package blobfs
+
+import (
+	"fmt"
+	"io/fs"
+)
+
+// A ChecksumError reports that the bytes read back for a file didn't
+// match the MD5 digest the backend reported for it (see WithVerifyMD5).
+// It wraps an *fs.PathError, so code that only checks for fs.PathError
+// keeps working unchanged.
+type ChecksumError struct {
+	*fs.PathError
+	Got  []byte
+	Want []byte
+}
+
+func newChecksumError(op, path string, got, want []byte) *ChecksumError {
+	return &ChecksumError{
+		PathError: &fs.PathError{
+			Op:   op,
+			Path: path,
+			Err:  fmt.Errorf("checksum mismatch: got %x, want %x", got, want),
+		},
+		Got:  got,
+		Want: want,
+	}
+}
+
+// Unwrap returns the wrapped *fs.PathError, so errors.As can find it.
+func (e *ChecksumError) Unwrap() error { return e.PathError }
+
+// Checksum returns the MD5 digest the backend reported for name, without
+// fetching its content. It returns nil if the backend reported no MD5 for
+// the object. Callers can use this to implement HTTP ETag /
+// If-None-Match handling without downloading the object.
+func (fsys *FS) Checksum(name string) ([]byte, error) {
+	ctx, _ := fsys.ioFSArgs()
+	e, err := fsys.lookup(ctx, name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "checksum", Path: name, Err: err}
+	}
+	if e.IsDir() {
+		return nil, &fs.PathError{Op: "checksum", Path: name, Err: fs.ErrInvalid}
+	}
+	return e.obj.MD5, nil
+}
@@ -0,0 +1,135 @@
+package blobfs_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"errors"
+	"io"
+	"testing"
+
+	"gocloud.dev/blob"
+	_ "gocloud.dev/blob/memblob"
+
+	"github.com/ichizero/blobfs"
+)
+
+func TestFS_VerifyMD5(t *testing.T) {
+	ctx := context.Background()
+	bucket, err := blob.OpenBucket(ctx, "mem://")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := bucket.NewWriter(ctx, "foo.txt", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte("hello, world")); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	fsys := blobfs.New(bucket, blobfs.WithVerifyMD5())
+
+	want, err := fsys.Checksum("foo.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := fsys.ReadFile("foo.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := md5.Sum(b)
+	if !bytes.Equal(got[:], want) {
+		t.Fatalf("Checksum() = %x, want %x", want, got)
+	}
+}
+
+// TestFS_VerifyMD5_StreamingRead exercises the openFile.Read streaming path
+// (as io.Copy/io.ReadAll would) rather than ReadFile, reading in chunks too
+// small to finish in a single Read call.
+func TestFS_VerifyMD5_StreamingRead(t *testing.T) {
+	ctx := context.Background()
+	bucket, err := blob.OpenBucket(ctx, "mem://")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := bucket.NewWriter(ctx, "foo.txt", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte("hello, world")
+	if _, err := w.Write(want); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	fsys := blobfs.New(bucket, blobfs.WithVerifyMD5())
+	f, err := fsys.Open("foo.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var got bytes.Buffer
+	buf := make([]byte, 4)
+	for {
+		n, err := f.Read(buf)
+		got.Write(buf[:n])
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !bytes.Equal(got.Bytes(), want) {
+		t.Fatalf("streamed content = %q, want %q", got.Bytes(), want)
+	}
+}
+
+// TestFS_VerifyMD5_StreamingRead_Corrupted proves that WithVerifyMD5 still
+// catches corruption on the streaming Read path: the bucket's content is
+// swapped out from under an already-open file, so the bytes Read actually
+// streams back no longer match the MD5 captured when the file was opened.
+func TestFS_VerifyMD5_StreamingRead_Corrupted(t *testing.T) {
+	ctx := context.Background()
+	bucket, err := blob.OpenBucket(ctx, "mem://")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bucket.WriteAll(ctx, "foo.txt", []byte("hello, world"), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	fsys := blobfs.New(bucket, blobfs.WithVerifyMD5())
+	f, err := fsys.Open("foo.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	// Same length, different content, so the already-open file's cached
+	// size still matches but its cached MD5 no longer does.
+	if err := bucket.WriteAll(ctx, "foo.txt", []byte("HELLO, WORLD"), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 4)
+	var lastErr error
+	for {
+		_, err := f.Read(buf)
+		if err != nil {
+			lastErr = err
+			break
+		}
+	}
+	var checksumErr *blobfs.ChecksumError
+	if !errors.As(lastErr, &checksumErr) {
+		t.Fatalf("Read() error = %v, want *blobfs.ChecksumError", lastErr)
+	}
+}
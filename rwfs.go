@@ -0,0 +1,297 @@
+package blobfs
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+
+	"gocloud.dev/blob"
+)
+
+const (
+	opCreate = "create"
+	opMkdir  = "mkdir"
+	opRemove = "remove"
+	opRename = "rename"
+)
+
+// A RWFS is a FS that also allows creating, writing, and removing blobs.
+// Build one with NewRW; it embeds *FS, so every read-only method of FS
+// keeps working unchanged.
+type RWFS struct {
+	*FS
+}
+
+// NewRW returns a RWFS that can read and write files in a blob storage.
+func NewRW(bucket *blob.Bucket, opts ...Option) *RWFS {
+	return &RWFS{FS: New(bucket, opts...)}
+}
+
+// A WritableFile is an open blob being written to. Writes are buffered
+// locally and only uploaded to the underlying bucket when Close succeeds,
+// so an error returned before Close (or a crash) leaves the object tree
+// untouched. Concurrent writers to the same key race the underlying
+// bucket's last-writer-wins semantics: whichever Close finishes last wins.
+type WritableFile interface {
+	io.Writer
+	io.Closer
+}
+
+// Create creates or truncates the named file and returns a WritableFile
+// for writing to it. The blob is not written to the bucket until the
+// returned file's Close is called.
+func (fsys *RWFS) Create(name string) (WritableFile, error) {
+	if !fs.ValidPath(name) || name == "." {
+		return nil, &fs.PathError{Op: opCreate, Path: name, Err: fs.ErrInvalid}
+	}
+	return fsys.newRWFile(name), nil
+}
+
+// OpenFile opens the named file with the given os.O_* flag. Read-only
+// flags (the zero value, or os.O_RDONLY) delegate to Open. Otherwise it
+// returns a WritableFile wrapped as an fs.File: os.O_APPEND seeds the
+// write buffer with the file's current content, and os.O_CREATE is
+// required unless the file already exists. perm is accepted for
+// interface compatibility with os.OpenFile but is unused: blob storage
+// has no permission bits.
+func (fsys *RWFS) OpenFile(name string, flag int, perm fs.FileMode) (fs.File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR) == 0 {
+		return fsys.Open(name)
+	}
+	if !fs.ValidPath(name) || name == "." {
+		return nil, &fs.PathError{Op: opOpen, Path: name, Err: fs.ErrInvalid}
+	}
+
+	f := fsys.newRWFile(name)
+	switch {
+	case flag&os.O_APPEND != 0:
+		b, err := fsys.ReadFile(name)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, &fs.PathError{Op: opOpen, Path: name, Err: err}
+		}
+		if err != nil && flag&os.O_CREATE == 0 {
+			return nil, &fs.PathError{Op: opOpen, Path: name, Err: fs.ErrNotExist}
+		}
+		if _, err := f.buf.Write(b); err != nil {
+			return nil, &fs.PathError{Op: opOpen, Path: name, Err: err}
+		}
+	case flag&os.O_CREATE == 0:
+		if _, err := fsys.Stat(name); err != nil {
+			return nil, &fs.PathError{Op: opOpen, Path: name, Err: fs.ErrNotExist}
+		}
+	}
+	return f, nil
+}
+
+// Mkdir creates name as a directory by writing a zero-byte object at
+// name+"/", the same placeholder searchDir and ReadDir already recognise
+// as a directory.
+func (fsys *RWFS) Mkdir(name string) error {
+	if !fs.ValidPath(name) || name == "." {
+		return &fs.PathError{Op: opMkdir, Path: name, Err: fs.ErrInvalid}
+	}
+	ctx, _ := fsys.ioFSArgs()
+	key := fsys.fullKey(name)
+	w, err := fsys.bucket.NewWriter(ctx, key+"/", nil)
+	if err != nil {
+		return &fs.PathError{Op: opMkdir, Path: name, Err: err}
+	}
+	if err := w.Close(); err != nil {
+		return &fs.PathError{Op: opMkdir, Path: name, Err: err}
+	}
+	fsys.invalidateCache(key)
+	fsys.invalidateCache(key + "/")
+	return nil
+}
+
+// Remove removes the named file. It refuses to remove a directory unless
+// it is empty.
+func (fsys *RWFS) Remove(name string) error {
+	if name == "." {
+		return &fs.PathError{Op: opRemove, Path: name, Err: fs.ErrInvalid}
+	}
+	ctx, _ := fsys.ioFSArgs()
+	e, err := fsys.lookup(ctx, name)
+	if err != nil {
+		return &fs.PathError{Op: opRemove, Path: name, Err: err}
+	}
+	key := e.Path()
+	if e.IsDir() {
+		entries, err := fsys.ReadDir(name)
+		if err != nil {
+			return &fs.PathError{Op: opRemove, Path: name, Err: err}
+		}
+		if len(entries) > 0 {
+			return &fs.PathError{Op: opRemove, Path: name, Err: errors.New("directory not empty")}
+		}
+		if key == "" {
+			key = fsys.fullKey(name) + "/"
+		}
+	}
+	if err := fsys.bucket.Delete(ctx, key); err != nil {
+		return &fs.PathError{Op: opRemove, Path: name, Err: err}
+	}
+	fsys.invalidateCache(key)
+	fsys.invalidateCache(strings.TrimSuffix(key, "/"))
+	return nil
+}
+
+// Rename renames (moves) old to new. Blob storage has no native move
+// operation, so Rename copies the object to new and then deletes old; a
+// failure between the two leaves the object reachable under both names.
+func (fsys *RWFS) Rename(old, new string) error {
+	if !fs.ValidPath(old) || old == "." {
+		return &fs.PathError{Op: opRename, Path: old, Err: fs.ErrInvalid}
+	}
+	if !fs.ValidPath(new) || new == "." {
+		return &fs.PathError{Op: opRename, Path: new, Err: fs.ErrInvalid}
+	}
+	ctx, _ := fsys.ioFSArgs()
+	oldKey, newKey := fsys.fullKey(old), fsys.fullKey(new)
+	if err := fsys.bucket.Copy(ctx, newKey, oldKey, nil); err != nil {
+		return &fs.PathError{Op: opRename, Path: old, Err: err}
+	}
+	if err := fsys.bucket.Delete(ctx, oldKey); err != nil {
+		return &fs.PathError{Op: opRename, Path: old, Err: err}
+	}
+	fsys.invalidateCache(oldKey)
+	fsys.invalidateCache(oldKey + "/")
+	fsys.invalidateCache(newKey)
+	fsys.invalidateCache(newKey + "/")
+	return nil
+}
+
+// rwFile is the WritableFile (and fs.File) returned by Create and
+// OpenFile. It buffers every write via buf and only talks to the bucket
+// in Close.
+type rwFile struct {
+	fsys   *RWFS
+	name   string
+	key    string
+	buf    *spillBuffer
+	closed bool
+}
+
+var _ fs.File = (*rwFile)(nil)
+
+func (fsys *RWFS) newRWFile(name string) *rwFile {
+	return &rwFile{
+		fsys: fsys,
+		name: name,
+		key:  fsys.fullKey(name),
+		buf:  &spillBuffer{threshold: fsys.writeSpillThreshold()},
+	}
+}
+
+func (f *rwFile) Write(b []byte) (int, error) {
+	if f.closed {
+		return 0, &fs.PathError{Op: "write", Path: f.name, Err: fs.ErrClosed}
+	}
+	n, err := f.buf.Write(b)
+	if err != nil {
+		return n, &fs.PathError{Op: "write", Path: f.name, Err: err}
+	}
+	return n, nil
+}
+
+func (f *rwFile) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: opRead, Path: f.name, Err: errors.New("file is not open for reading")}
+}
+
+func (f *rwFile) Stat() (fs.FileInfo, error) {
+	return &fileListEntry{obj: &blob.ListObject{Key: f.key, Size: f.buf.size}}, nil
+}
+
+// Close uploads the buffered content to the bucket and releases any
+// spilled temporary file. It is safe to call more than once; only the
+// first call does any work.
+func (f *rwFile) Close() error {
+	if f.closed {
+		return nil
+	}
+	f.closed = true
+	defer f.buf.close()
+
+	r, err := f.buf.reader()
+	if err != nil {
+		return &fs.PathError{Op: "close", Path: f.name, Err: err}
+	}
+	ctx, _ := f.fsys.ioFSArgs()
+	w, err := f.fsys.bucket.NewWriter(ctx, f.key, nil)
+	if err != nil {
+		return &fs.PathError{Op: "close", Path: f.name, Err: err}
+	}
+	if _, err := io.Copy(w, r); err != nil {
+		w.Close()
+		return &fs.PathError{Op: "close", Path: f.name, Err: err}
+	}
+	if err := w.Close(); err != nil {
+		return &fs.PathError{Op: "close", Path: f.name, Err: err}
+	}
+	f.fsys.invalidateCache(f.key)
+	return nil
+}
+
+// spillBuffer accumulates written bytes in memory up to threshold; the
+// write that would exceed it moves everything buffered so far, and every
+// later write, to a temporary file so a large write doesn't have to be
+// held entirely in RAM before it can be uploaded on Close.
+type spillBuffer struct {
+	threshold int64
+	buf       bytes.Buffer
+	spill     *os.File
+	size      int64
+}
+
+func (b *spillBuffer) Write(p []byte) (int, error) {
+	if b.spill != nil {
+		n, err := b.spill.Write(p)
+		b.size += int64(n)
+		return n, err
+	}
+	if int64(b.buf.Len())+int64(len(p)) <= b.threshold {
+		n, err := b.buf.Write(p)
+		b.size += int64(n)
+		return n, err
+	}
+
+	f, err := os.CreateTemp("", "blobfs-*")
+	if err != nil {
+		return 0, err
+	}
+	if _, err := f.Write(b.buf.Bytes()); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return 0, err
+	}
+	b.buf = bytes.Buffer{}
+	b.spill = f
+	n, err := b.spill.Write(p)
+	b.size += int64(n)
+	return n, err
+}
+
+func (b *spillBuffer) reader() (io.Reader, error) {
+	if b.spill == nil {
+		return bytes.NewReader(b.buf.Bytes()), nil
+	}
+	if _, err := b.spill.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return b.spill, nil
+}
+
+func (b *spillBuffer) close() error {
+	if b.spill == nil {
+		return nil
+	}
+	name := b.spill.Name()
+	err := b.spill.Close()
+	if rmErr := os.Remove(name); err == nil {
+		err = rmErr
+	}
+	return err
+}
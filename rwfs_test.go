@@ -0,0 +1,124 @@
+package blobfs_test
+
+import (
+	"context"
+	"io"
+	"os"
+	"testing"
+
+	"gocloud.dev/blob"
+	_ "gocloud.dev/blob/memblob"
+
+	"github.com/ichizero/blobfs"
+)
+
+func TestRWFS(t *testing.T) {
+	ctx := context.Background()
+	bucket, err := blob.OpenBucket(ctx, "mem://")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fsys := blobfs.NewRW(bucket)
+
+	f, err := fsys.Create("greeting.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.WriteString(f, "hello"); err != nil {
+		t.Fatal(err)
+	}
+	if exists, err := bucket.Exists(ctx, "greeting.txt"); err != nil {
+		t.Fatal(err)
+	} else if exists {
+		t.Fatal("object should not exist before Close")
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := fsys.ReadFile("greeting.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "hello" {
+		t.Fatalf("got %q, want %q", b, "hello")
+	}
+
+	if err := fsys.Mkdir("dir"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fsys.Remove("dir"); err != nil {
+		t.Fatal(err)
+	}
+
+	af, err := fsys.OpenFile("greeting.txt", os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, ok := af.(io.Writer)
+	if !ok {
+		t.Fatal("file opened for writing should implement io.Writer")
+	}
+	if _, err := io.WriteString(w, ", world"); err != nil {
+		t.Fatal(err)
+	}
+	if err := af.Close(); err != nil {
+		t.Fatal(err)
+	}
+	b, err = fsys.ReadFile("greeting.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "hello, world" {
+		t.Fatalf("got %q, want %q", b, "hello, world")
+	}
+
+	if err := fsys.Rename("greeting.txt", "renamed.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fsys.Stat("greeting.txt"); err == nil {
+		t.Fatal("greeting.txt should no longer exist after Rename")
+	}
+	if _, err := fsys.Stat("renamed.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := fsys.Remove("renamed.txt"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestRWFS_Root checks that "." -- a valid fs.FS path denoting the root --
+// is rejected by the operations that write a single object, instead of
+// silently writing one at the root's own key ("" or "/").
+func TestRWFS_Root(t *testing.T) {
+	ctx := context.Background()
+	bucket, err := blob.OpenBucket(ctx, "mem://")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fsys := blobfs.NewRW(bucket)
+
+	if _, err := fsys.Create("."); err == nil {
+		t.Fatal("Create(\".\") should fail")
+	}
+	if err := fsys.Mkdir("."); err == nil {
+		t.Fatal("Mkdir(\".\") should fail")
+	}
+	if err := fsys.Remove("."); err == nil {
+		t.Fatal("Remove(\".\") should fail")
+	}
+	if err := fsys.Rename(".", "elsewhere"); err == nil {
+		t.Fatal("Rename(\".\", ...) should fail")
+	}
+	if err := fsys.Rename("renamed.txt", "."); err == nil {
+		t.Fatal("Rename(..., \".\") should fail")
+	}
+
+	if objs, _, err := bucket.ListPage(ctx, blob.FirstPageToken, 10, nil); err != nil {
+		t.Fatal(err)
+	} else if len(objs) != 0 {
+		t.Fatalf("bucket should still be empty, got %d objects", len(objs))
+	}
+}